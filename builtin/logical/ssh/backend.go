@@ -44,17 +44,25 @@ func Backend(conf *logical.BackendConfig) (*framework.Backend, error) {
 
 		Paths: []*framework.Path{
 			pathConfigLease(&b),
+			pathConfigInstall(&b),
+			pathConfigCheck(&b),
 			pathKeys(&b),
 			pathRoles(&b),
+			pathRolesPreview(&b),
+			pathRolesInventory(&b),
 			pathCredsCreate(&b),
 			pathLookup(&b),
 			pathVerify(&b),
+			pathRemovalsFailed(&b),
 		},
 
 		Secrets: []*framework.Secret{
 			secretDynamicKey(&b),
 			secretOTP(&b),
 		},
+
+		Rollback:       b.rollback,
+		RollbackMinAge: removalRetryInterval,
 	}
 	return b.Backend, nil
 }
@@ -1,16 +1,28 @@
 package ssh
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net"
 	"os/user"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/armon/go-metrics"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/hashicorp/vault/vault"
 	"github.com/mitchellh/mapstructure"
@@ -167,6 +179,26 @@ func TestSSHBackend_DynamicRoleCrud(t *testing.T) {
 	})
 }
 
+func TestSSHBackend_RolePreview(t *testing.T) {
+	data := map[string]interface{}{
+		"key_type":         testDynamicKeyType,
+		"key":              testKeyName,
+		"admin_user":       testAdminUser,
+		"default_user":     testAdminUser,
+		"cidr_list":        testCIDRList,
+		"key_option_specs": "no-pty",
+	}
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testNamedKeysWrite(t),
+			testRoleWrite(t, testDynamicRoleName, data),
+			testRolePreviewRead(t, testDynamicRoleName,
+				fmt.Sprintf("no-pty %s vault-%s", previewPublicKeyPlaceholder, testAdminUser)),
+		},
+	})
+}
+
 func TestSSHBackend_NamedKeysCrud(t *testing.T) {
 	logicaltest.Test(t, logicaltest.TestCase{
 		Factory: Factory,
@@ -194,6 +226,559 @@ func TestSSHBackend_OTPCreate(t *testing.T) {
 	})
 }
 
+func TestSSHBackend_OTPStrictIP(t *testing.T) {
+	data := map[string]interface{}{
+		"key_type":     testOTPKeyType,
+		"default_user": testUserName,
+		"cidr_list":    "127.0.0.0/24",
+		"strict_ip":    true,
+	}
+
+	// The OTP gets filled in once the credential is created.
+	wrongIPData := map[string]interface{}{
+		"ip": "127.0.0.2",
+	}
+	rightIPData := map[string]interface{}{
+		"ip": testIP,
+	}
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testRoleWrite(t, testOTPRoleName, data),
+			logicaltest.TestStep{
+				Operation: logical.WriteOperation,
+				Path:      fmt.Sprintf("creds/%s", testOTPRoleName),
+				Data: map[string]interface{}{
+					"ip": testIP,
+				},
+				Check: func(resp *logical.Response) error {
+					if resp == nil || resp.Data["key"] == nil {
+						return fmt.Errorf("bad: %#v", resp)
+					}
+					wrongIPData["otp"] = resp.Data["key"]
+					rightIPData["otp"] = resp.Data["key"]
+					return nil
+				},
+			},
+			logicaltest.TestStep{
+				Operation: logical.WriteOperation,
+				Path:      "verify",
+				Data:      wrongIPData,
+				ErrorOk:   true,
+				Check: func(resp *logical.Response) error {
+					if resp == nil || !resp.IsError() {
+						return fmt.Errorf("expected error for a different IP: %#v", resp)
+					}
+					return nil
+				},
+			},
+			testVerifyWrite(t, rightIPData, map[string]interface{}{
+				"username": testUserName,
+				"ip":       testIP,
+			}),
+		},
+	})
+}
+
+func TestSSHBackend_HostKeyCallback(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testSharedPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	hostPublicKey := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	otherPublicKey, err := ssh.NewPublicKey(&otherKey.PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Both the authorized_keys format and known_hosts entries are accepted.
+	for _, expected := range []string{hostPublicKey, testIP + " " + hostPublicKey} {
+		callback, err := hostKeyCallback(expected)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := callback(testIP, nil, signer.PublicKey()); err != nil {
+			t.Fatalf("matching host key rejected: %s", err)
+		}
+		if err := callback(testIP, nil, otherPublicKey); err == nil {
+			t.Fatalf("mismatching host key accepted")
+		}
+	}
+
+	// Without an expected key, any host key is accepted.
+	callback, err := hostKeyCallback("")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := callback(testIP, nil, otherPublicKey); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSSHBackend_DynamicKeyCreateHostPublicKey(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testSharedPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data := map[string]interface{}{
+		"key_type":        testDynamicKeyType,
+		"key":             testKeyName,
+		"admin_user":      testAdminUser,
+		"default_user":    testAdminUser,
+		"cidr_list":       testCIDRList,
+		"port":            testPort,
+		"install_script":  testInstallScript,
+		"host_public_key": string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+	}
+	invalidData := map[string]interface{}{
+		"key_type":        testDynamicKeyType,
+		"key":             testKeyName,
+		"admin_user":      testAdminUser,
+		"default_user":    testAdminUser,
+		"cidr_list":       testCIDRList,
+		"host_public_key": "not-a-key",
+	}
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testNamedKeysWrite(t),
+			testRoleWriteError(t, testDynamicRoleName, invalidData),
+			testRoleWrite(t, testDynamicRoleName, data),
+			testDynamicKeyCredsCreate(t),
+		},
+	})
+}
+
+func TestSSHBackend_ConfigInstall(t *testing.T) {
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testConfigInstallRead(t, DefaultInstallConcurrency),
+			logicaltest.TestStep{
+				Operation: logical.WriteOperation,
+				Path:      "config/install",
+				Data: map[string]interface{}{
+					"install_concurrency": 2,
+				},
+			},
+			testConfigInstallRead(t, 2),
+		},
+	})
+}
+
+func TestSSHBackend_runConcurrently(t *testing.T) {
+	var lock sync.Mutex
+	var running, maxRunning int
+	processed := make([]bool, 20)
+
+	errs := runConcurrently(len(processed), 3, func(i int) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		processed[i] = true
+		lock.Unlock()
+
+		if i%2 == 0 {
+			return fmt.Errorf("host %d failed", i)
+		}
+		return nil
+	})
+
+	if maxRunning > 3 {
+		t.Fatalf("concurrency not capped: %d", maxRunning)
+	}
+	for i, ok := range processed {
+		if !ok {
+			t.Fatalf("host %d not processed", i)
+		}
+		if (i%2 == 0) != (errs[i] != nil) {
+			t.Fatalf("bad error for host %d: %v", i, errs[i])
+		}
+	}
+}
+
+func TestSSHBackend_IssuanceMetrics(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	conf := metrics.DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	metrics.NewGlobal(conf, sink)
+
+	storage := new(logical.InmemStorage)
+	b, err := Factory(&logical.BackendConfig{View: storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Nothing listens on this port, which makes the key installation fail.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.WriteOperation, path)
+		req.Storage = storage
+		req.MountPoint = "ssh/prod/"
+		req.Data = data
+		return b.HandleRequest(req)
+	}
+
+	steps := []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"keys/" + testKeyName, map[string]interface{}{
+			"key": testSharedPrivateKey,
+		}},
+		{"roles/" + testOTPRoleName, map[string]interface{}{
+			"key_type":     testOTPKeyType,
+			"default_user": testUserName,
+			"cidr_list":    testCIDRList,
+		}},
+		{"roles/" + testDynamicRoleName, map[string]interface{}{
+			"key_type":       testDynamicKeyType,
+			"key":            testKeyName,
+			"admin_user":     testAdminUser,
+			"default_user":   testAdminUser,
+			"cidr_list":      testCIDRList,
+			"port":           testPort,
+			"install_script": testInstallScript,
+		}},
+		{"roles/unreachable", map[string]interface{}{
+			"key_type":       testDynamicKeyType,
+			"key":            testKeyName,
+			"admin_user":     testAdminUser,
+			"default_user":   testAdminUser,
+			"cidr_list":      testCIDRList,
+			"port":           closedPort,
+			"install_script": testInstallScript,
+		}},
+		{"creds/" + testOTPRoleName, map[string]interface{}{
+			"ip": testIP,
+		}},
+		{"creds/" + testDynamicRoleName, map[string]interface{}{
+			"ip": testIP,
+		}},
+	}
+	for _, step := range steps {
+		resp, err := request(step.path, step.data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%s resp:%#v", step.path, err, resp)
+		}
+	}
+
+	if _, err := request("creds/unreachable", map[string]interface{}{"ip": testIP}); err == nil {
+		t.Fatalf("expected key installation to fail")
+	}
+
+	counters := sink.Data()[0].Counters
+	for _, name := range []string{
+		"ssh.otp.issued.ssh_prod",
+		"ssh.dynamic.issued.ssh_prod",
+		"ssh.dynamic.install_failed.ssh_prod",
+	} {
+		if counters[name] == nil || counters[name].Count != 1 {
+			t.Fatalf("bad counter %s: %#v", name, counters[name])
+		}
+	}
+}
+
+func TestSSHBackend_encodePrivateKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, keyFormat := range []string{KeyFormatOpenSSH, KeyFormatPEM, KeyFormatPKCS8} {
+		encoded, err := encodePrivateKey(privateKey, keyFormat)
+		if err != nil {
+			t.Fatalf("%s: err: %s", keyFormat, err)
+		}
+
+		var signer ssh.Signer
+		if keyFormat == KeyFormatPKCS8 {
+			block, _ := pem.Decode([]byte(encoded))
+			if block == nil || block.Type != "PRIVATE KEY" {
+				t.Fatalf("%s: bad PEM block: %s", keyFormat, encoded)
+			}
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("%s: err: %s", keyFormat, err)
+			}
+			signer, err = ssh.NewSignerFromKey(key)
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(encoded))
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", keyFormat, err)
+		}
+
+		if !bytes.Equal(signer.PublicKey().Marshal(), expected.PublicKey().Marshal()) {
+			t.Fatalf("%s: key did not round-trip", keyFormat)
+		}
+	}
+
+	if _, err := encodePrivateKey(privateKey, "putty"); err == nil {
+		t.Fatalf("expected error for unknown key format")
+	}
+}
+
+func TestSSHBackend_CredsInvalidKeyFormat(t *testing.T) {
+	b, err := Factory(&logical.BackendConfig{View: new(logical.InmemStorage)})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	req := logical.TestRequest(t, logical.WriteOperation, "creds/"+testDynamicRoleName)
+	req.Data = map[string]interface{}{
+		"ip":         testIP,
+		"key_format": "putty",
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: %#v", resp)
+	}
+}
+
+func TestSSHBackend_ConfigCheck(t *testing.T) {
+	storage := new(logical.InmemStorage)
+	b, err := Factory(&logical.BackendConfig{View: storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%s resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+
+	roleData := func(keyName string) map[string]interface{} {
+		return map[string]interface{}{
+			"key_type":     testDynamicKeyType,
+			"key":          keyName,
+			"admin_user":   testAdminUser,
+			"default_user": testAdminUser,
+			"cidr_list":    testCIDRList,
+		}
+	}
+
+	keyData := map[string]interface{}{"key": testSharedPrivateKey}
+	request(logical.WriteOperation, "keys/healthy", keyData)
+	request(logical.WriteOperation, "keys/removed", keyData)
+	request(logical.WriteOperation, "roles/healthy", roleData("healthy"))
+	request(logical.WriteOperation, "roles/broken", roleData("removed"))
+	request(logical.DeleteOperation, "keys/removed", nil)
+
+	resp := request(logical.ReadOperation, "config/check", nil)
+	if resp.Data["healthy"].(bool) {
+		t.Fatalf("backend should not be healthy: %#v", resp.Data)
+	}
+
+	roles := resp.Data["roles"].(map[string]interface{})
+	if len(roles) != 2 || roles["healthy"] != KeyTypeDynamic || roles["broken"] != KeyTypeDynamic {
+		t.Fatalf("bad roles: %#v", roles)
+	}
+
+	passed := make(map[string]bool)
+	for _, check := range resp.Data["checks"].([]map[string]interface{}) {
+		passed[check["name"].(string)] = check["passed"].(bool)
+	}
+	expected := map[string]bool{
+		"salt":          true,
+		"roles/healthy": true,
+		"roles/broken":  false,
+	}
+	if !reflect.DeepEqual(passed, expected) {
+		t.Fatalf("bad checks: expected %#v got %#v", expected, passed)
+	}
+}
+
+func TestSSHBackend_RequireInventory(t *testing.T) {
+	storage := new(logical.InmemStorage)
+	b, err := Factory(&logical.BackendConfig{View: storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, logical.WriteOperation, path)
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+		return resp
+	}
+
+	resp := request("roles/"+testOTPRoleName, map[string]interface{}{
+		"key_type":          testOTPKeyType,
+		"default_user":      testUserName,
+		"cidr_list":         "127.0.0.0/8",
+		"require_inventory": true,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// No inventory means no IP is approved.
+	resp = request("creds/"+testOTPRoleName, map[string]interface{}{"ip": "127.0.0.1"})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: %#v", resp)
+	}
+
+	resp = request("roles/"+testOTPRoleName+"/inventory", map[string]interface{}{
+		"hosts": "127.0.0.1",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Within the CIDR block, but not in the inventory.
+	resp = request("creds/"+testOTPRoleName, map[string]interface{}{"ip": "127.0.0.2"})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: %#v", resp)
+	}
+
+	resp = request("creds/"+testOTPRoleName, map[string]interface{}{"ip": "127.0.0.1"})
+	if resp == nil || resp.IsError() || resp.Data["key"] == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestSSHBackend_RemovalRetry(t *testing.T) {
+	storage := new(logical.InmemStorage)
+	b, err := Factory(&logical.BackendConfig{View: storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%s resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+	request(logical.WriteOperation, "keys/"+testKeyName, map[string]interface{}{
+		"key": testSharedPrivateKey,
+	})
+
+	// The target is unreachable while the lease is revoked.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	targetAddr := ln.Addr().String()
+	ln.Close()
+
+	req := logical.TestRequest(t, logical.RevokeOperation, "")
+	req.Storage = storage
+	req.Secret = &logical.Secret{
+		InternalData: map[string]interface{}{
+			"secret_type":        SecretDynamicKeyType,
+			"admin_user":         testAdminUser,
+			"username":           testUserName,
+			"ip":                 "127.0.0.1",
+			"host_key_name":      testKeyName,
+			"dynamic_public_key": "ssh-rsa AAAAB3NzaC1yc2E vault-" + testUserName,
+			"port":               float64(ln.Addr().(*net.TCPAddr).Port),
+			"install_script":     testInstallScript,
+		},
+	}
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("revoke should succeed and queue the removal: %s", err)
+	}
+
+	rollback := map[string]interface{}{"immediate": true}
+	testRemovalAttempts(t, storage, 1)
+
+	// Still unreachable, the removal is queued again.
+	request(logical.RollbackOperation, "", rollback)
+	testRemovalAttempts(t, storage, 2)
+
+	// The target is back and the removal succeeds.
+	proxy := testProxy(t, targetAddr, fmt.Sprintf("%s:%d", testIP, testPort))
+	defer proxy.Close()
+	request(logical.RollbackOperation, "", rollback)
+	testRemovalAttempts(t, storage, 0)
+
+	resp := request(logical.ReadOperation, "removals/failed", nil)
+	if removals := resp.Data["removals"].([]map[string]interface{}); len(removals) != 0 {
+		t.Fatalf("bad: %#v", removals)
+	}
+}
+
+func TestSSHBackend_RemovalRetryGiveUp(t *testing.T) {
+	storage := new(logical.InmemStorage)
+	b, err := Factory(&logical.BackendConfig{View: storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The host key is missing, so the removal keeps failing.
+	_, err = framework.PutWAL(storage, walKindRemoval, &dynamicKeyRemoval{
+		Username:    testUserName,
+		IP:          "127.0.0.1",
+		HostKeyName: testKeyName,
+		Attempts:    maxRemovalAttempts - 1,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	req := logical.TestRequest(t, logical.RollbackOperation, "")
+	req.Storage = storage
+	req.Data["immediate"] = true
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testRemovalAttempts(t, storage, 0)
+
+	req = logical.TestRequest(t, logical.ReadOperation, "removals/failed")
+	req.Storage = storage
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	removals := resp.Data["removals"].([]map[string]interface{})
+	if len(removals) != 1 || removals[0]["attempts"] != maxRemovalAttempts || removals[0]["last_error"] == "" {
+		t.Fatalf("bad: %#v", removals)
+	}
+}
+
 func TestSSHBackend_VerifyEcho(t *testing.T) {
 	verifyData := map[string]interface{}{
 		"otp": api.VerifyEchoRequest,
@@ -326,6 +911,34 @@ func testRoleWrite(t *testing.T, name string, data map[string]interface{}) logic
 	}
 }
 
+func testConfigInstallRead(t *testing.T, concurrency int) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      "config/install",
+		Check: func(resp *logical.Response) error {
+			if resp == nil || resp.Data["install_concurrency"] != concurrency {
+				return fmt.Errorf("bad: %#v", resp)
+			}
+			return nil
+		},
+	}
+}
+
+func testRoleWriteError(t *testing.T, name string, data map[string]interface{}) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.WriteOperation,
+		Path:      "roles/" + name,
+		Data:      data,
+		ErrorOk:   true,
+		Check: func(resp *logical.Response) error {
+			if !resp.IsError() {
+				return fmt.Errorf("expected error: %#v", resp)
+			}
+			return nil
+		},
+	}
+}
+
 func testRoleRead(t *testing.T, name string, data map[string]interface{}) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.ReadOperation,
@@ -355,6 +968,22 @@ func testRoleRead(t *testing.T, name string, data map[string]interface{}) logica
 	}
 }
 
+func testRolePreviewRead(t *testing.T, name, expected string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("roles/%s/preview", name),
+		Check: func(resp *logical.Response) error {
+			if resp == nil || resp.Data == nil {
+				return fmt.Errorf("bad: %#v", resp)
+			}
+			if resp.Data["authorized_keys_line"] != expected {
+				return fmt.Errorf("bad: authorized_keys_line: %#v", resp.Data["authorized_keys_line"])
+			}
+			return nil
+		},
+	}
+}
+
 func testRoleDelete(t *testing.T, name string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.DeleteOperation,
@@ -404,3 +1033,63 @@ func testDynamicKeyCredsCreate(t *testing.T) logicaltest.TestStep {
 		},
 	}
 }
+
+// Checks the number of attempts of the queued removal. Zero means that no
+// removal is queued.
+func testRemovalAttempts(t *testing.T, s logical.Storage, attempts int) {
+	keys, err := framework.ListWAL(s)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if attempts == 0 {
+		if len(keys) != 0 {
+			t.Fatalf("removal should not be queued: %v", keys)
+		}
+		return
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected one queued removal: %v", keys)
+	}
+
+	entry, err := framework.GetWAL(s, keys[0])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var removal dynamicKeyRemoval
+	if err := mapstructure.Decode(entry.Data, &removal); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if removal.Attempts != attempts {
+		t.Fatalf("bad attempts: expected %d got %d", attempts, removal.Attempts)
+	}
+}
+
+// Listens on the given address and forwards the connections to the target.
+func testProxy(t *testing.T, addr, target string) net.Listener {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			targetConn, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(targetConn, conn)
+				targetConn.Close()
+			}()
+			go func() {
+				io.Copy(conn, targetConn)
+				conn.Close()
+			}()
+		}
+	}()
+	return ln
+}
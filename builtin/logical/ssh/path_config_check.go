@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Result of a single check run by the 'config/check' endpoint.
+type configCheck struct {
+	Name    string
+	Passed  bool
+	Message string
+}
+
+func pathConfigCheck(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/check",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathConfigCheckRead,
+		},
+		HelpSynopsis:    pathConfigCheckHelpSyn,
+		HelpDescription: pathConfigCheckHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigCheckRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var checks []configCheck
+
+	// OTPs are stored and verified by their salted value.
+	saltCheck := configCheck{
+		Name:   "salt",
+		Passed: b.salt != nil,
+	}
+	if !saltCheck.Passed {
+		saltCheck.Message = "backend has no salt configured"
+	}
+	checks = append(checks, saltCheck)
+
+	roleNames, err := req.Storage.List("roles/")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]interface{}, len(roleNames))
+	for _, roleName := range roleNames {
+		roleCheck := configCheck{
+			Name:   fmt.Sprintf("roles/%s", roleName),
+			Passed: true,
+		}
+
+		role, err := b.getRole(req.Storage, roleName)
+		switch {
+		case err != nil:
+			roleCheck.Passed = false
+			roleCheck.Message = fmt.Sprintf("error reading role: %s", err)
+		case role == nil:
+			// The role was deleted while the check was running.
+			continue
+		case role.KeyType == KeyTypeDynamic:
+			roles[roleName] = role.KeyType
+			key, err := b.getKey(req.Storage, role.KeyName)
+			if err != nil {
+				roleCheck.Passed = false
+				roleCheck.Message = fmt.Sprintf("error reading key '%s': %s", role.KeyName, err)
+			} else if key == nil {
+				roleCheck.Passed = false
+				roleCheck.Message = fmt.Sprintf("key '%s' not found", role.KeyName)
+			}
+		case role.KeyType == KeyTypeOTP:
+			roles[roleName] = role.KeyType
+		default:
+			roles[roleName] = role.KeyType
+			roleCheck.Passed = false
+			roleCheck.Message = fmt.Sprintf("unknown key type '%s'", role.KeyType)
+		}
+		checks = append(checks, roleCheck)
+	}
+
+	healthy := true
+	checksRaw := make([]map[string]interface{}, 0, len(checks))
+	for _, check := range checks {
+		healthy = healthy && check.Passed
+		checksRaw = append(checksRaw, map[string]interface{}{
+			"name":    check.Name,
+			"passed":  check.Passed,
+			"message": check.Message,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"healthy": healthy,
+			"roles":   roles,
+			"checks":  checksRaw,
+		},
+	}, nil
+}
+
+const pathConfigCheckHelpSyn = `
+Check the configuration of the backend for problems.
+`
+
+const pathConfigCheckHelpDesc = `
+This path runs a set of checks against the configuration of the backend
+and reports the result of each check. It verifies that the backend has a
+salt to store OTPs with, and that every dynamic role refers to a named key
+that exists. The key type of every role is listed as well. 'healthy' is
+true only when all the checks passed.
+`
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// DefaultInstallConcurrency is the number of targets that keys are installed
+// in or removed from in parallel, when it is not configured.
+const DefaultInstallConcurrency = 5
+
+type configInstall struct {
+	InstallConcurrency int `json:"install_concurrency"`
+}
+
+func pathConfigInstall(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/install",
+		Fields: map[string]*framework.FieldSchema{
+			"install_concurrency": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "[Optional] Maximum number of targets that dynamic keys are installed in or removed from in parallel. Defaults to 5.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:  b.pathConfigInstallRead,
+			logical.WriteOperation: b.pathConfigInstallWrite,
+		},
+
+		HelpSynopsis:    pathConfigInstallHelpSyn,
+		HelpDescription: pathConfigInstallHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigInstallWrite(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	installConcurrency := d.Get("install_concurrency").(int)
+	if installConcurrency < 0 {
+		return logical.ErrorResponse("Invalid 'install_concurrency'"), nil
+	}
+	if installConcurrency == 0 {
+		installConcurrency = DefaultInstallConcurrency
+	}
+
+	entry, err := logical.StorageEntryJSON("config/install", &configInstall{
+		InstallConcurrency: installConcurrency,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage entry JSON: %s", err)
+	}
+
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, fmt.Errorf("could not store JSON: %s", err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigInstallRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.InstallConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"install_concurrency": config.InstallConcurrency,
+		},
+	}, nil
+}
+
+// InstallConfig returns the install configuration of the backend. If it was
+// never configured, the defaults are returned.
+func (b *backend) InstallConfig(s logical.Storage) (*configInstall, error) {
+	result := &configInstall{
+		InstallConcurrency: DefaultInstallConcurrency,
+	}
+
+	entry, err := s.Get("config/install")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return result, nil
+	}
+
+	if err := entry.DecodeJSON(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Calls fn for each of the n items, with at most 'concurrency' calls running
+// at any point of time. The error returned for each item is collected at the
+// index of the item.
+func runConcurrently(n, concurrency int, fn func(i int) error) []error {
+	if concurrency <= 0 {
+		concurrency = DefaultInstallConcurrency
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+const pathConfigInstallHelpSyn = `
+Configure how dynamic keys are installed in the targets.
+`
+
+const pathConfigInstallHelpDesc = `
+This configures the installation of dynamic keys in the targets. When keys
+are installed in or removed from many targets by a single request, at most
+'install_concurrency' targets are contacted in parallel. The error for each
+target is reported separately.
+`
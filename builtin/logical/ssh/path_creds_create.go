@@ -11,9 +11,16 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+const (
+	KeyFormatOpenSSH = "openssh"
+	KeyFormatPKCS8   = "pkcs8"
+	KeyFormatPEM     = "pem"
+)
+
 type sshOTP struct {
 	Username string `json:"username"`
 	IP       string `json:"ip"`
+	StrictIP bool   `json:"strict_ip"`
 }
 
 func pathCredsCreate(b *backend) *framework.Path {
@@ -32,6 +39,11 @@ func pathCredsCreate(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "[Required] IP of the remote host",
 			},
+			"key_format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     KeyFormatOpenSSH,
+				Description: "[Optional for Dynamic type] Format of the returned private key: 'openssh', 'pkcs8' or 'pem'. Defaults to 'openssh'.",
+			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.WriteOperation: b.pathCredsCreateWrite,
@@ -53,6 +65,13 @@ func (b *backend) pathCredsCreateWrite(
 		return logical.ErrorResponse("Missing ip"), nil
 	}
 
+	keyFormat := d.Get("key_format").(string)
+	switch keyFormat {
+	case KeyFormatOpenSSH, KeyFormatPKCS8, KeyFormatPEM:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("Invalid key_format '%s'", keyFormat)), nil
+	}
+
 	role, err := b.getRole(req.Storage, roleName)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving role: %s", err)
@@ -97,13 +116,25 @@ func (b *backend) pathCredsCreateWrite(
 		return logical.ErrorResponse(fmt.Sprintf("Error validating IP: %s", err)), nil
 	}
 
+	// If the role requires it, the IP must also be in the inventory of the role.
+	if role.RequireInventory {
+		contains, err := b.inventoryContainsIP(req.Storage, roleName, ip)
+		if err != nil {
+			return nil, fmt.Errorf("error reading inventory: %s", err)
+		}
+		if !contains {
+			return logical.ErrorResponse(fmt.Sprintf("IP '%s' is not in the inventory of role '%s'", ip, roleName)), nil
+		}
+	}
+
 	var result *logical.Response
 	if role.KeyType == KeyTypeOTP {
 		// Generate an OTP
-		otp, err := b.GenerateOTPCredential(req, username, ip)
+		otp, err := b.GenerateOTPCredential(req, role, username, ip)
 		if err != nil {
 			return nil, err
 		}
+		incrCounter(req, "otp", "issued")
 
 		// Return the information relevant to user of OTP type and save
 		// the data required for later use in the internal section of secret.
@@ -121,10 +152,11 @@ func (b *backend) pathCredsCreateWrite(
 	} else if role.KeyType == KeyTypeDynamic {
 		// Generate an RSA key pair. This also installs the newly generated
 		// public key in the remote host.
-		dynamicPublicKey, dynamicPrivateKey, err := b.GenerateDynamicCredential(req, role, username, ip)
+		dynamicPublicKey, dynamicPrivateKey, err := b.GenerateDynamicCredential(req, role, username, ip, keyFormat)
 		if err != nil {
 			return nil, err
 		}
+		incrCounter(req, "dynamic", "issued")
 
 		// Return the information relevant to user of dynamic type and save
 		// information required for later use in internal section of secret.
@@ -142,6 +174,7 @@ func (b *backend) pathCredsCreateWrite(
 			"dynamic_public_key": dynamicPublicKey,
 			"port":               role.Port,
 			"install_script":     role.InstallScript,
+			"host_public_key":    role.HostPublicKey,
 		})
 	} else {
 		return nil, fmt.Errorf("key type unknown")
@@ -165,8 +198,9 @@ func (b *backend) pathCredsCreateWrite(
 	return result, nil
 }
 
-// Generates a RSA key pair and installs it in the remote target
-func (b *backend) GenerateDynamicCredential(req *logical.Request, role *sshRole, username, ip string) (string, string, error) {
+// Generates a RSA key pair and installs it in the remote target. The private
+// key is returned in the given format.
+func (b *backend) GenerateDynamicCredential(req *logical.Request, role *sshRole, username, ip, keyFormat string) (string, string, error) {
 	// Fetch the host key to be used for dynamic key installation
 	keyEntry, err := req.Storage.Get(fmt.Sprintf("keys/%s", role.KeyName))
 	if err != nil {
@@ -183,18 +217,17 @@ func (b *backend) GenerateDynamicCredential(req *logical.Request, role *sshRole,
 	}
 
 	// Generate a new RSA key pair with the given key length.
-	dynamicPublicKey, dynamicPrivateKey, err := generateRSAKeys(role.KeyBits)
+	dynamicPublicKey, dynamicPrivateKey, err := generateRSAKeys(role.KeyBits, keyFormat)
 	if err != nil {
 		return "", "", fmt.Errorf("error generating key: %s", err)
 	}
 
-	if len(role.KeyOptionSpecs) != 0 {
-		dynamicPublicKey = fmt.Sprintf("%s %s", role.KeyOptionSpecs, dynamicPublicKey)
-	}
+	dynamicPublicKey = authorizedKeysLine(role, username, dynamicPublicKey)
 
 	// Add the public key to authorized_keys file in target machine
-	err = b.installPublicKeyInTarget(role.AdminUser, username, ip, role.Port, hostKey.Key, dynamicPublicKey, role.InstallScript, true)
+	err = b.installPublicKeyInTarget(role.AdminUser, username, ip, role.Port, hostKey.Key, role.HostPublicKey, dynamicPublicKey, role.InstallScript, true)
 	if err != nil {
+		incrCounter(req, "dynamic", "install_failed")
 		return "", "", fmt.Errorf("error adding public key to authorized_keys file in target")
 	}
 	return dynamicPublicKey, dynamicPrivateKey, nil
@@ -207,7 +240,7 @@ func (b *backend) GenerateSaltedOTP() (string, string) {
 }
 
 // Generates an UUID OTP and creates an entry for the same in storage backend with its salted string.
-func (b *backend) GenerateOTPCredential(req *logical.Request, username, ip string) (string, error) {
+func (b *backend) GenerateOTPCredential(req *logical.Request, role *sshRole, username, ip string) (string, error) {
 	otp, otpSalted := b.GenerateSaltedOTP()
 
 	// Check if there is an entry already created for the newly generated OTP.
@@ -229,6 +262,7 @@ func (b *backend) GenerateOTPCredential(req *logical.Request, username, ip strin
 	newEntry, err := logical.StorageEntryJSON("otp/"+otpSalted, sshOTP{
 		Username: username,
 		IP:       ip,
+		StrictIP: role.StrictIP,
 	})
 	if err != nil {
 		return "", err
@@ -293,6 +327,11 @@ Create named key using the 'keys/' endpoint, and this represents the
 shared SSH key of target host. If this backend is mounted at 'ssh',
 then "ssh/creds/web" would generate a key for 'web' role.
 
+The private key of a dynamic credential is returned in the format given
+by 'key_format'. The 'openssh' and 'pem' formats return a PEM encoded
+PKCS#1 key, which is what OpenSSH reads. The 'pkcs8' format returns a
+PEM encoded PKCS#8 key for the tools that require it.
+
 Keys will have a lease associated with them. The access keys can be
 revoked by using the lease ID.
 `
@@ -0,0 +1,155 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// Kind of the WAL entries of dynamic keys whose removal from the target
+	// failed while revoking the lease.
+	walKindRemoval = "removal"
+
+	// Minimum time between two attempts to remove a dynamic key.
+	removalRetryInterval = 5 * time.Minute
+
+	// Number of failed attempts after which a removal is given up on and
+	// reported at 'removals/failed'.
+	maxRemovalAttempts = 10
+)
+
+// Information required to remove a dynamic key from the target.
+type dynamicKeyRemoval struct {
+	AdminUser        string `mapstructure:"admin_user" json:"admin_user"`
+	Username         string `mapstructure:"username" json:"username"`
+	IP               string `mapstructure:"ip" json:"ip"`
+	Port             int    `mapstructure:"port" json:"port"`
+	HostKeyName      string `mapstructure:"host_key_name" json:"host_key_name"`
+	HostPublicKey    string `mapstructure:"host_public_key" json:"host_public_key"`
+	DynamicPublicKey string `mapstructure:"dynamic_public_key" json:"dynamic_public_key"`
+	InstallScript    string `mapstructure:"install_script" json:"install_script"`
+	Attempts         int    `mapstructure:"attempts" json:"attempts"`
+	LastError        string `mapstructure:"last_error" json:"last_error"`
+}
+
+func pathRemovalsFailed(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "removals/failed",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRemovalsFailedRead,
+			logical.DeleteOperation: b.pathRemovalsFailedDelete,
+		},
+		HelpSynopsis:    pathRemovalsFailedHelpSyn,
+		HelpDescription: pathRemovalsFailedHelpDesc,
+	}
+}
+
+func (b *backend) pathRemovalsFailedRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List("removals/failed/")
+	if err != nil {
+		return nil, err
+	}
+
+	removals := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		entry, err := req.Storage.Get("removals/failed/" + key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		var removal dynamicKeyRemoval
+		if err := entry.DecodeJSON(&removal); err != nil {
+			return nil, err
+		}
+		removals = append(removals, map[string]interface{}{
+			"username":   removal.Username,
+			"ip":         removal.IP,
+			"port":       removal.Port,
+			"public_key": removal.DynamicPublicKey,
+			"attempts":   removal.Attempts,
+			"last_error": removal.LastError,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"removals": removals,
+		},
+	}, nil
+}
+
+func (b *backend) pathRemovalsFailedDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List("removals/failed/")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if err := req.Storage.Delete("removals/failed/" + key); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Queues the removal of a dynamic key which failed with the given error, to
+// be retried by the periodic rollback of the backend.
+func (b *backend) queueRemoval(s logical.Storage, removal *dynamicKeyRemoval, cause error) error {
+	removal.Attempts++
+	removal.LastError = cause.Error()
+
+	if removal.Attempts >= maxRemovalAttempts {
+		log.Printf("[ERR] ssh: giving up removing dynamic key of '%s' from '%s' after %d attempts: %s",
+			removal.Username, removal.IP, removal.Attempts, cause)
+		id, err := logical.UUID()
+		if err != nil {
+			return err
+		}
+		entry, err := logical.StorageEntryJSON("removals/failed/"+id, removal)
+		if err != nil {
+			return err
+		}
+		return s.Put(entry)
+	}
+
+	_, err := framework.PutWAL(s, walKindRemoval, removal)
+	return err
+}
+
+// Called periodically for the WAL entries of the backend which are older
+// than removalRetryInterval. A failed removal is queued again with a new
+// WAL entry, so that the attempts are counted.
+func (b *backend) rollback(req *logical.Request, kind string, data interface{}) error {
+	if kind != walKindRemoval {
+		return fmt.Errorf("unknown type to rollback")
+	}
+
+	var removal dynamicKeyRemoval
+	if err := mapstructure.Decode(data, &removal); err != nil {
+		return err
+	}
+
+	if err := b.removeDynamicKey(req.Storage, &removal); err != nil {
+		return b.queueRemoval(req.Storage, &removal, err)
+	}
+	return nil
+}
+
+const pathRemovalsFailedHelpSyn = `
+List the dynamic keys that could not be removed from the targets.
+`
+
+const pathRemovalsFailedHelpDesc = `
+When the lease of a dynamic key is revoked and the key can't be removed
+from the target, the removal is retried periodically. After 10 failed
+attempts, the removal is given up on and listed here along with the last
+error, so that the key can be removed from the target by other means.
+Deleting this path clears the list.
+`
@@ -17,17 +17,20 @@ const (
 // for both OTP and Dynamic roles. Not all the fields are mandatory for both type.
 // Some are applicable for one and not for other. It doesn't matter.
 type sshRole struct {
-	KeyType         string `mapstructure:"key_type" json:"key_type"`
-	KeyName         string `mapstructure:"key" json:"key"`
-	KeyBits         int    `mapstructure:"key_bits" json:"key_bits"`
-	AdminUser       string `mapstructure:"admin_user" json:"admin_user"`
-	DefaultUser     string `mapstructure:"default_user" json:"default_user"`
-	CIDRList        string `mapstructure:"cidr_list" json:"cidr_list"`
-	ExcludeCIDRList string `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
-	Port            int    `mapstructure:"port" json:"port"`
-	InstallScript   string `mapstructure:"install_script" json:"install_script"`
-	AllowedUsers    string `mapstructure:"allowed_users" json:"allowed_users"`
-	KeyOptionSpecs  string `mapstructure:"key_option_specs" json:"key_option_specs"`
+	KeyType          string `mapstructure:"key_type" json:"key_type"`
+	KeyName          string `mapstructure:"key" json:"key"`
+	KeyBits          int    `mapstructure:"key_bits" json:"key_bits"`
+	AdminUser        string `mapstructure:"admin_user" json:"admin_user"`
+	DefaultUser      string `mapstructure:"default_user" json:"default_user"`
+	CIDRList         string `mapstructure:"cidr_list" json:"cidr_list"`
+	ExcludeCIDRList  string `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
+	Port             int    `mapstructure:"port" json:"port"`
+	InstallScript    string `mapstructure:"install_script" json:"install_script"`
+	AllowedUsers     string `mapstructure:"allowed_users" json:"allowed_users"`
+	KeyOptionSpecs   string `mapstructure:"key_option_specs" json:"key_option_specs"`
+	StrictIP         bool   `mapstructure:"strict_ip" json:"strict_ip"`
+	HostPublicKey    string `mapstructure:"host_public_key" json:"host_public_key"`
+	RequireInventory bool   `mapstructure:"require_inventory" json:"require_inventory"`
 }
 
 func pathRoles(b *backend) *framework.Path {
@@ -130,6 +133,35 @@ func pathRoles(b *backend) *framework.Path {
 				file format and should not contain spaces.
 				`,
 			},
+			"host_public_key": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Optional for Dynamic type] [Not applicable for OTP type]
+				Public key of the target hosts, either in authorized_keys format or as
+				a known_hosts entry. If set, Vault verifies that the target presents
+				this key while connecting as the admin user and refuses to install
+				keys otherwise. If not set, the host key of the target is not verified.
+				`,
+			},
+			"strict_ip": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for OTP type] [Not applicable for Dynamic type]
+				If set, an OTP can only be verified by supplying the same IP address
+				for which it was created. This prevents an OTP from being used to
+				connect to a different host, even if the host belongs to the role.
+				Defaults to false.
+				`,
+			},
+			"require_inventory": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for both types]
+				If set, credentials are only created for the IPs that are present in
+				the inventory of the role, managed at 'roles/<role>/inventory', even if
+				the IP belongs to the CIDR blocks of the role. Defaults to false.
+				`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -192,12 +224,14 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 
 		// Below are the only fields used from the role structure for OTP type.
 		roleEntry = sshRole{
-			DefaultUser:     defaultUser,
-			CIDRList:        cidrList,
-			ExcludeCIDRList: excludeCidrList,
-			KeyType:         KeyTypeOTP,
-			Port:            port,
-			AllowedUsers:    allowedUsers,
+			DefaultUser:      defaultUser,
+			CIDRList:         cidrList,
+			ExcludeCIDRList:  excludeCidrList,
+			KeyType:          KeyTypeOTP,
+			Port:             port,
+			AllowedUsers:     allowedUsers,
+			StrictIP:         d.Get("strict_ip").(bool),
+			RequireInventory: d.Get("require_inventory").(bool),
 		}
 	} else if keyType == KeyTypeDynamic {
 		// Key name is required by dynamic type and not by OTP type.
@@ -224,6 +258,13 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 			return logical.ErrorResponse("Missing admin username"), nil
 		}
 
+		hostPublicKey := d.Get("host_public_key").(string)
+		if hostPublicKey != "" {
+			if _, err := parseHostPublicKey(hostPublicKey); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("Invalid host_public_key: %s", err)), nil
+			}
+		}
+
 		// This defaults to 1024 and it can also be 2048.
 		keyBits := d.Get("key_bits").(int)
 		if keyBits != 0 && keyBits != 1024 && keyBits != 2048 {
@@ -237,17 +278,19 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 
 		// Store all the fields required by dynamic key type
 		roleEntry = sshRole{
-			KeyName:         keyName,
-			AdminUser:       adminUser,
-			DefaultUser:     defaultUser,
-			CIDRList:        cidrList,
-			ExcludeCIDRList: excludeCidrList,
-			Port:            port,
-			KeyType:         KeyTypeDynamic,
-			KeyBits:         keyBits,
-			InstallScript:   installScript,
-			AllowedUsers:    allowedUsers,
-			KeyOptionSpecs:  keyOptionSpecs,
+			KeyName:          keyName,
+			AdminUser:        adminUser,
+			DefaultUser:      defaultUser,
+			CIDRList:         cidrList,
+			ExcludeCIDRList:  excludeCidrList,
+			Port:             port,
+			KeyType:          KeyTypeDynamic,
+			KeyBits:          keyBits,
+			InstallScript:    installScript,
+			AllowedUsers:     allowedUsers,
+			KeyOptionSpecs:   keyOptionSpecs,
+			HostPublicKey:    hostPublicKey,
+			RequireInventory: d.Get("require_inventory").(bool),
 		}
 	} else {
 		return logical.ErrorResponse("Invalid key type"), nil
@@ -300,6 +343,8 @@ func (b *backend) pathRoleRead(req *logical.Request, d *framework.FieldData) (*l
 				"key_type":          role.KeyType,
 				"port":              role.Port,
 				"allowed_users":     role.AllowedUsers,
+				"strict_ip":         role.StrictIP,
+				"require_inventory": role.RequireInventory,
 			},
 		}, nil
 	} else {
@@ -315,6 +360,8 @@ func (b *backend) pathRoleRead(req *logical.Request, d *framework.FieldData) (*l
 				"key_bits":          role.KeyBits,
 				"allowed_users":     role.AllowedUsers,
 				"key_option_specs":  role.KeyOptionSpecs,
+				"host_public_key":   role.HostPublicKey,
+				"require_inventory": role.RequireInventory,
 				// Returning install script will make the output look messy.
 				// But this is one way for clients to see the script that is
 				// being used to install the key. If there is some problem,
@@ -331,6 +378,12 @@ func (b *backend) pathRoleDelete(req *logical.Request, d *framework.FieldData) (
 	if err != nil {
 		return nil, err
 	}
+
+	// The inventory is of no use without the role.
+	err = req.Storage.Delete(fmt.Sprintf("inventory/%s", roleName))
+	if err != nil {
+		return nil, err
+	}
 	return nil, nil
 }
 
@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Set of approved hosts of a role. Entries are either IP addresses or
+// hostnames, which are resolved when a credential is requested.
+type sshInventory struct {
+	Hosts []string `json:"hosts"`
+}
+
+func pathRolesInventory(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("role") + "/inventory",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "[Required] Name of the role",
+			},
+			"hosts": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "[Required] Comma separated list of approved IP addresses and hostnames",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRolesInventoryRead,
+			logical.WriteOperation:  b.pathRolesInventoryWrite,
+			logical.DeleteOperation: b.pathRolesInventoryDelete,
+		},
+		HelpSynopsis:    pathRolesInventoryHelpSyn,
+		HelpDescription: pathRolesInventoryHelpDesc,
+	}
+}
+
+func (b *backend) pathRolesInventoryWrite(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get("role").(string)
+	role, err := b.getRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", roleName)), nil
+	}
+
+	var hosts []string
+	for _, host := range strings.Split(d.Get("hosts").(string), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return logical.ErrorResponse("Missing hosts"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("inventory/%s", roleName), &sshInventory{
+		Hosts: hosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRolesInventoryRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	inventory, err := b.getInventory(req.Storage, d.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if inventory == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"hosts": strings.Join(inventory.Hosts, ","),
+		},
+	}, nil
+}
+
+func (b *backend) pathRolesInventoryDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	err := req.Storage.Delete(fmt.Sprintf("inventory/%s", d.Get("role").(string)))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) getInventory(s logical.Storage, roleName string) (*sshInventory, error) {
+	entry, err := s.Get(fmt.Sprintf("inventory/%s", roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result sshInventory
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Checks if the IP is one of the hosts in the inventory of the role. Hostnames
+// in the inventory match the IP if they resolve to it.
+func (b *backend) inventoryContainsIP(s logical.Storage, roleName, ip string) (bool, error) {
+	inventory, err := b.getInventory(s, roleName)
+	if err != nil {
+		return false, err
+	}
+	if inventory == nil {
+		return false, nil
+	}
+
+	for _, host := range inventory.Hosts {
+		if host == ip {
+			return true, nil
+		}
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if net.ParseIP(addr).String() == ip {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+const pathRolesInventoryHelpSyn = `
+Manage the inventory of approved hosts of a role.
+`
+
+const pathRolesInventoryHelpDesc = `
+This path manages the inventory of a role, which is a list of approved IP
+addresses and hostnames. If the role has 'require_inventory' set, credentials
+are only created for IPs present in the inventory, even if the IP belongs to
+the CIDR blocks of the role. Hostnames are resolved when a credential is
+requested. Deleting the role deletes its inventory as well.
+`
@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Placeholder used in place of the key material while rendering the line
+// that would be installed in the target for a dynamic key.
+const previewPublicKeyPlaceholder = "ssh-rsa <generated-public-key>"
+
+func pathRolesPreview(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("role") + "/preview",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "[Required] Name of the role",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathRolesPreviewRead,
+		},
+		HelpSynopsis:    pathRolesPreviewHelpSyn,
+		HelpDescription: pathRolesPreviewHelpDesc,
+	}
+}
+
+func (b *backend) pathRolesPreviewRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get("role").(string)
+	role, err := b.getRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	// Only dynamic keys get installed in the targets.
+	if role.KeyType != KeyTypeDynamic {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' is not of dynamic type", roleName)), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"username":             role.DefaultUser,
+			"key_option_specs":     role.KeyOptionSpecs,
+			"authorized_keys_line": authorizedKeysLine(role, role.DefaultUser, previewPublicKeyPlaceholder),
+		},
+	}, nil
+}
+
+const pathRolesPreviewHelpSyn = `
+Preview the authorized_keys line installed for the role's dynamic keys.
+`
+
+const pathRolesPreviewHelpDesc = `
+This path renders the line that would be installed in the authorized_keys
+file of the target when a dynamic key is generated for the 'default_user'
+of the role. The key material is replaced by a placeholder and no key is
+generated or installed. The option specifications and the comment appear
+exactly as they would in the installed line.
+`
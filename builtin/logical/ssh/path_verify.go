@@ -1,6 +1,8 @@
 package ssh
 
 import (
+	"net"
+
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -14,6 +16,10 @@ func pathVerify(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "[Required] One-Time-Key that needs to be validated",
 			},
+			"ip": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "[Optional] IP address of the host the OTP is being used to connect to",
+			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.WriteOperation: b.pathVerifyWrite,
@@ -68,6 +74,17 @@ func (b *backend) pathVerifyWrite(req *logical.Request, d *framework.FieldData)
 		return nil, nil
 	}
 
+	// If the role demanded it, the OTP can only be used to connect to the
+	// host it was created for. The OTP is left intact so that it can still
+	// be used with the right host.
+	if otpEntry.StrictIP {
+		ipRaw := d.Get("ip").(string)
+		ipAddr := net.ParseIP(ipRaw)
+		if ipAddr == nil || ipAddr.String() != otpEntry.IP {
+			return logical.ErrorResponse("OTP is not valid for the given IP"), nil
+		}
+	}
+
 	// Delete the OTP if found. This is what makes the key an OTP.
 	err = req.Storage.Delete("otp/" + otpSalted)
 	if err != nil {
@@ -93,4 +110,7 @@ provided by the client is sent to Vault for validation by the agent. If Vault
 finds an entry for the OTP, it responds with the username and IP it is associated
 with. Agent uses this information to authenticate the client. Vault deletes the
 OTP after validating it once.
+
+If the OTP was created for a role with 'strict_ip' set, the 'ip' parameter must
+be supplied and must match the IP address the OTP was created for.
 `
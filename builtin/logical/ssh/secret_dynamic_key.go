@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -97,26 +98,55 @@ func (b *backend) secretDynamicKeyRevoke(req *logical.Request, d *framework.Fiel
 		return nil, fmt.Errorf("secret is missing internal data")
 	}
 
+	// Secrets created before the host public key was introduced don't have
+	// it in the internal data and will not verify the host key.
+	var hostPublicKey string
+	if hostPublicKeyRaw, ok := req.Secret.InternalData["host_public_key"]; ok {
+		hostPublicKey, _ = hostPublicKeyRaw.(string)
+	}
+
 	portRaw, ok := req.Secret.InternalData["port"]
 	if !ok {
 		return nil, fmt.Errorf("secret is missing internal data")
 	}
 	port := int(portRaw.(float64))
 
+	removal := &dynamicKeyRemoval{
+		AdminUser:        adminUser,
+		Username:         username,
+		IP:               ip,
+		Port:             port,
+		HostKeyName:      hostKeyName,
+		HostPublicKey:    hostPublicKey,
+		DynamicPublicKey: dynamicPublicKey,
+		InstallScript:    installScript,
+	}
+	if err := b.removeDynamicKey(req.Storage, removal); err != nil {
+		// The lease is revoked regardless, so that the key doesn't linger
+		// in the target, the removal is queued and retried periodically.
+		log.Printf("[WARN] ssh: failed to remove dynamic key of '%s' from '%s', queued for retry: %s", username, ip, err)
+		if err := b.queueRemoval(req.Storage, removal, err); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Removes the public key from authorized_keys file in target machine.
+func (b *backend) removeDynamicKey(s logical.Storage, removal *dynamicKeyRemoval) error {
 	// Fetch the host key using the key name
-	hostKey, err := b.getKey(req.Storage, hostKeyName)
+	hostKey, err := b.getKey(s, removal.HostKeyName)
 	if err != nil {
-		return nil, fmt.Errorf("key '%s' not found error:%s", hostKeyName, err)
+		return fmt.Errorf("key '%s' not found error:%s", removal.HostKeyName, err)
 	}
 	if hostKey == nil {
-		return nil, fmt.Errorf("key '%s' not found", hostKeyName)
+		return fmt.Errorf("key '%s' not found", removal.HostKeyName)
 	}
 
-	// Remove the public key from authorized_keys file in target machine
 	// The last param 'false' indicates that the key should be uninstalled.
-	err = b.installPublicKeyInTarget(adminUser, username, ip, port, hostKey.Key, dynamicPublicKey, installScript, false)
+	err = b.installPublicKeyInTarget(removal.AdminUser, removal.Username, removal.IP, removal.Port, hostKey.Key, removal.HostPublicKey, removal.DynamicPublicKey, removal.InstallScript, false)
 	if err != nil {
-		return nil, fmt.Errorf("error removing public key from authorized_keys file in target")
+		return fmt.Errorf("error removing public key from authorized_keys file in target: %s", err)
 	}
-	return nil, nil
+	return nil
 }
@@ -8,10 +8,12 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/logical"
 
 	"golang.org/x/crypto/ssh"
@@ -20,7 +22,7 @@ import (
 // Creates a SSH session object which can be used to run commands
 // in the target machine. The session will use public key authentication
 // method with port 22.
-func createSSHPublicKeysSession(username, ipAddr string, port int, hostKey string) (*ssh.Session, error) {
+func createSSHPublicKeysSession(username, ipAddr string, port int, hostKey, hostPublicKey string) (*ssh.Session, error) {
 	if username == "" {
 		return nil, fmt.Errorf("missing username")
 	}
@@ -35,11 +37,17 @@ func createSSHPublicKeysSession(username, ipAddr string, port int, hostKey strin
 		return nil, fmt.Errorf("parsing Private Key failed: %s", err)
 	}
 
+	callback, err := hostKeyCallback(hostPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
 	config := &ssh.ClientConfig{
 		User: username,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
+		HostKeyCallback: callback,
 	}
 
 	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", ipAddr, port), config)
@@ -58,17 +66,17 @@ func createSSHPublicKeysSession(username, ipAddr string, port int, hostKey strin
 }
 
 // Creates a new RSA key pair with the given key length. The private key will be
-// of pem format and the public key will be of OpenSSH format.
-func generateRSAKeys(keyBits int) (publicKeyRsa string, privateKeyRsa string, err error) {
+// PEM encoded in the given format and the public key will be of OpenSSH format.
+func generateRSAKeys(keyBits int, keyFormat string) (publicKeyRsa string, privateKeyRsa string, err error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, keyBits)
 	if err != nil {
 		return "", "", fmt.Errorf("error generating RSA key-pair: %s", err)
 	}
 
-	privateKeyRsa = string(pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}))
+	privateKeyRsa, err = encodePrivateKey(privateKey, keyFormat)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating RSA key-pair: %s", err)
+	}
 
 	sshPublicKey, err := ssh.NewPublicKey(privateKey.Public())
 	if err != nil {
@@ -78,17 +86,61 @@ func generateRSAKeys(keyBits int) (publicKeyRsa string, privateKeyRsa string, er
 	return
 }
 
+// PEM encodes the private key in the given format. OpenSSH reads RSA keys in
+// the PKCS#1 encoding, so both 'openssh' and 'pem' formats yield a PKCS#1 key.
+// The 'pkcs8' format is meant for the tools and libraries that only accept
+// PKCS#8 keys.
+func encodePrivateKey(privateKey *rsa.PrivateKey, keyFormat string) (string, error) {
+	var block *pem.Block
+	switch keyFormat {
+	case KeyFormatOpenSSH, KeyFormatPEM:
+		block = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}
+	case KeyFormatPKCS8:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return "", err
+		}
+		block = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: keyBytes,
+		}
+	default:
+		return "", fmt.Errorf("unknown key format '%s'", keyFormat)
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// Builds the line that gets installed in the authorized_keys file of the
+// target for a dynamic key. Option specifications registered with the role
+// are prefixed to the key and a comment identifying the key as generated by
+// Vault for the given username is appended.
+func authorizedKeysLine(role *sshRole, username, publicKey string) string {
+	line := fmt.Sprintf("%s %s", publicKey, dynamicKeyComment(username))
+	if len(role.KeyOptionSpecs) != 0 {
+		line = fmt.Sprintf("%s %s", role.KeyOptionSpecs, line)
+	}
+	return line
+}
+
+// Returns the comment appended to the dynamic keys installed in the target.
+func dynamicKeyComment(username string) string {
+	return fmt.Sprintf("vault-%s", username)
+}
+
 // Public key and the script to install the key are uploaded to remote machine.
 // Public key is either added or removed from authorized_keys file using the
 // script. Default script is for a Linux machine and hence the path of the
 // authorized_keys file is hard coded to resemble Linux.
 //
 // The last param 'install' if false, uninstalls the key.
-func (b *backend) installPublicKeyInTarget(adminUser, username, ip string, port int, hostkey, dynamicPublicKey, installScript string, install bool) error {
+func (b *backend) installPublicKeyInTarget(adminUser, username, ip string, port int, hostkey, hostPublicKey, dynamicPublicKey, installScript string, install bool) error {
 	// Transfer the newly generated public key to remote host under a random
 	// file name. This is to avoid name collisions from other requests.
 	_, publicKeyFileName := b.GenerateSaltedOTP()
-	err := scpUpload(adminUser, ip, port, hostkey, publicKeyFileName, dynamicPublicKey)
+	err := scpUpload(adminUser, ip, port, hostkey, hostPublicKey, publicKeyFileName, dynamicPublicKey)
 	if err != nil {
 		return fmt.Errorf("error uploading public key: %s", err)
 	}
@@ -97,14 +149,14 @@ func (b *backend) installPublicKeyInTarget(adminUser, username, ip string, port
 	// host under a random file name as well. This is to avoid name collisions
 	// from other requests.
 	scriptFileName := fmt.Sprintf("%s.sh", publicKeyFileName)
-	err = scpUpload(adminUser, ip, port, hostkey, scriptFileName, installScript)
+	err = scpUpload(adminUser, ip, port, hostkey, hostPublicKey, scriptFileName, installScript)
 	if err != nil {
 		return fmt.Errorf("error uploading install script: %s", err)
 	}
 
 	// Create a session to run remote command that triggers the script to install
 	// or uninstall the key.
-	session, err := createSSHPublicKeysSession(adminUser, ip, port, hostkey)
+	session, err := createSSHPublicKeysSession(adminUser, ip, port, hostkey, hostPublicKey)
 	if err != nil {
 		return fmt.Errorf("unable to create SSH Session using public keys: %s", err)
 	}
@@ -190,13 +242,18 @@ func cidrListContainsIP(ip, cidrList string) (bool, error) {
 }
 
 // Uploads the file to the remote machine
-func scpUpload(username, ip string, port int, hostkey, fileName, fileContent string) error {
+func scpUpload(username, ip string, port int, hostkey, hostPublicKey, fileName, fileContent string) error {
 	signer, err := ssh.ParsePrivateKey([]byte(hostkey))
+	callback, err := hostKeyCallback(hostPublicKey)
+	if err != nil {
+		return err
+	}
 	clientConfig := &ssh.ClientConfig{
 		User: username,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
+		HostKeyCallback: callback,
 	}
 
 	connfunc := func() (net.Conn, error) {
@@ -225,3 +282,59 @@ func scpUpload(username, ip string, port int, hostkey, fileName, fileContent str
 	comm.Upload(fileName, bytes.NewBufferString(fileContent), nil)
 	return nil
 }
+
+// Parses the public key of a target host. The key can either be in the
+// authorized_keys format or be a known_hosts entry, in which case the
+// leading host name pattern is ignored.
+func parseHostPublicKey(hostPublicKey string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostPublicKey))
+	if err == nil {
+		return key, nil
+	}
+
+	fields := strings.Fields(hostPublicKey)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid host public key")
+	}
+	key, _, _, _, err = ssh.ParseAuthorizedKey([]byte(strings.Join(fields[1:], " ")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host public key: %s", err)
+	}
+	return key, nil
+}
+
+// Returns the callback that verifies the key presented by the target host
+// during the handshake against the expected host public key. If no key is
+// expected, any host key is accepted, which leaves the connection open to
+// man-in-the-middle attacks.
+func hostKeyCallback(hostPublicKey string) (func(string, net.Addr, ssh.PublicKey) error, error) {
+	if hostPublicKey == "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			log.Printf("[WARN] ssh: host key of '%s' not verified; set 'host_public_key' on the role", hostname)
+			return nil
+		}, nil
+	}
+
+	expected, err := parseHostPublicKey(hostPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !bytes.Equal(expected.Marshal(), key.Marshal()) {
+			return fmt.Errorf("host key of '%s' does not match the expected host public key", hostname)
+		}
+		return nil
+	}, nil
+}
+
+// Increments the SSH counter with the given name. The mount point of the
+// request is appended to the key so that the counters of the different
+// mounts of the backend can be told apart.
+func incrCounter(req *logical.Request, name ...string) {
+	key := append([]string{"ssh"}, name...)
+	if mount := strings.Trim(req.MountPoint, "/"); mount != "" {
+		key = append(key, strings.Replace(mount, "/", "_", -1))
+	}
+	metrics.IncrCounter(key, 1)
+}
@@ -250,6 +250,12 @@ func Commands(metaPtr *command.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"token-helper": func() (cli.Command, error) {
+			return &command.TokenHelperCommand{
+				Meta: meta,
+			}, nil
+		},
+
 		"token-renew": func() (cli.Command, error) {
 			return &command.TokenRenewCommand{
 				Meta: meta,
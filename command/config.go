@@ -32,16 +32,9 @@ type Config struct {
 // empty, then the default path will be used, or the environment variable
 // if set.
 func LoadConfig(path string) (*Config, error) {
-	if path == "" {
-		path = DefaultConfigPath
-	}
-	if v := os.Getenv(ConfigPathEnv); v != "" {
-		path = v
-	}
-
-	path, err := homedir.Expand(path)
+	path, err := ConfigPath(path)
 	if err != nil {
-		return nil, fmt.Errorf("Error expanding config path: %s", err)
+		return nil, err
 	}
 
 	var config Config
@@ -63,3 +56,21 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &config, nil
 }
+
+// ConfigPath returns the expanded path of the configuration file. If path is
+// empty, then the default path will be used, or the environment variable
+// if set.
+func ConfigPath(path string) (string, error) {
+	if path == "" {
+		path = DefaultConfigPath
+	}
+	if v := os.Getenv(ConfigPathEnv); v != "" {
+		path = v
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", fmt.Errorf("Error expanding config path: %s", err)
+	}
+	return path, nil
+}
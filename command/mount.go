@@ -3,6 +3,8 @@ package command
 import (
 	"fmt"
 	"strings"
+
+	"github.com/hashicorp/vault/api"
 )
 
 // MountCommand is a Command that mounts a new mount.
@@ -11,10 +13,13 @@ type MountCommand struct {
 }
 
 func (c *MountCommand) Run(args []string) int {
-	var description, path string
+	var description, path, attachPolicy string
+	var atomic bool
 	flags := c.Meta.FlagSet("mount", FlagSetDefault)
 	flags.StringVar(&description, "description", "", "")
 	flags.StringVar(&path, "path", "", "")
+	flags.StringVar(&attachPolicy, "attach-policy", "", "")
+	flags.BoolVar(&atomic, "atomic", false, "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -52,9 +57,50 @@ func (c *MountCommand) Run(args []string) int {
 		"Successfully mounted '%s' at '%s'!",
 		mountType, path))
 
+	if attachPolicy == "" {
+		return 0
+	}
+
+	if err := c.attachPolicy(client, attachPolicy, path); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error attaching policy '%s': %s", attachPolicy, err))
+
+		if atomic {
+			if err := client.Sys().Unmount(path); err != nil {
+				c.Ui.Error(fmt.Sprintf(
+					"Error rolling back mount at '%s': %s", path, err))
+				return 2
+			}
+			c.Ui.Error(fmt.Sprintf("Rolled back mount at '%s'", path))
+		}
+		return 2
+	}
+
+	c.Ui.Output(fmt.Sprintf(
+		"Successfully attached policy '%s' to '%s'!",
+		attachPolicy, path))
+
 	return 0
 }
 
+// attachPolicy adds a rule granting write access to everything under the
+// mount path to the existing policy with the given name.
+func (c *MountCommand) attachPolicy(client *api.Client, name, path string) error {
+	rules, err := client.Sys().GetPolicy(name)
+	if err != nil {
+		return err
+	}
+	if rules == "" {
+		return fmt.Errorf("policy not found")
+	}
+
+	rules += fmt.Sprintf(
+		"\npath \"%s/*\" {\n  policy = \"write\"\n}\n",
+		strings.TrimSuffix(path, "/"))
+
+	return client.Sys().PutPolicy(name, rules)
+}
+
 func (c *MountCommand) Synopsis() string {
 	return "Mount a logical backend"
 }
@@ -80,6 +126,14 @@ Mount Options:
   -path=<path>            Mount point for the logical backend. This defaults
                           to the type of the mount.
 
+  -attach-policy=<name>   Name of an existing policy to attach to the mount.
+                          After mounting, a rule granting write access to
+                          everything under the mount point is added to the
+                          policy.
+
+  -atomic                 If attaching the policy fails, unmount the newly
+                          mounted backend so that no partial change is left.
+
 `
 	return strings.TrimSpace(helpText)
 }
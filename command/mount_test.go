@@ -1,6 +1,7 @@
 package command
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/http"
@@ -47,3 +48,79 @@ func TestMount(t *testing.T) {
 		t.Fatal("should be generic type")
 	}
 }
+
+func TestMount_attachPolicy(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &MountCommand{
+		Meta: Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := client.Sys().PutPolicy("foo", `path "secret/*" { policy = "read" }`); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	args := []string{
+		"-address", addr,
+		"-attach-policy", "foo",
+		"generic",
+	}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	rules, err := client.Sys().GetPolicy("foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(rules, `path "generic/*"`) {
+		t.Fatalf("bad: %s", rules)
+	}
+}
+
+func TestMount_attachPolicyRollback(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &MountCommand{
+		Meta: Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+
+	args := []string{
+		"-address", addr,
+		"-attach-policy", "nonexistent",
+		"-atomic",
+		"generic",
+	}
+	if code := c.Run(args); code == 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := mounts["generic/"]; ok {
+		t.Fatal("mount should have been rolled back")
+	}
+}
@@ -35,6 +35,15 @@ func (c *RekeyCommand) Run(args []string) int {
 		return 1
 	}
 
+	// Validate the PGP keys locally, so that an unusable key doesn't leave
+	// a rekey operation started on the server.
+	if len(pgpKeys) > 0 {
+		if err := validatePGPKeys(pgpKeys, shares); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
 	client, err := c.Client()
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
@@ -139,6 +148,21 @@ func (c *RekeyCommand) Run(args []string) int {
 	return 0
 }
 
+// validatePGPKeys ensures that there is a usable PGP key for each of the
+// key shares.
+func validatePGPKeys(pgpKeys pgpkeys.PubKeyFilesFlag, shares int) error {
+	if len(pgpKeys) != shares {
+		return fmt.Errorf(
+			"-key-shares is %d but %d PGP keys were given with -pgp-keys; "+
+				"exactly one PGP key is required per key share",
+			shares, len(pgpKeys))
+	}
+	if _, err := pgpkeys.GetEntities(pgpKeys); err != nil {
+		return err
+	}
+	return nil
+}
+
 // initRekey is used to start the rekey process
 func (c *RekeyCommand) initRekey(client *api.Client, shares, threshold int, pgpKeys pgpkeys.PubKeyFilesFlag) int {
 	// Start the rekey
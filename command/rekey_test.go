@@ -2,6 +2,7 @@ package command
 
 import (
 	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
@@ -205,3 +206,91 @@ func TestRekey_init_pgp(t *testing.T) {
 
 	parseDecryptAndTestUnsealKeys(t, ui.OutputWriter.String(), token, core)
 }
+
+func TestRekey_init_pgpMalformed(t *testing.T) {
+	core, key, _ := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &RekeyCommand{
+		Key: hex.EncodeToString(key),
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+
+	tempDir, pubFiles, err := getPubKeyFiles(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := ioutil.WriteFile(pubFiles[1], []byte("not a pgp key"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{
+		"-address", addr,
+		"-init",
+		"-key-shares", "3",
+		"-pgp-keys", pubFiles[0] + "," + pubFiles[1] + "," + pubFiles[2],
+		"-key-threshold", "2",
+	}
+	if code := c.Run(args); code == 0 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "PGP key 2") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+
+	config, err := core.RekeyConfig()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config != nil {
+		t.Fatal("rekey should not have been started")
+	}
+}
+
+func TestRekey_init_pgpCountMismatch(t *testing.T) {
+	core, key, _ := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &RekeyCommand{
+		Key: hex.EncodeToString(key),
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+
+	tempDir, pubFiles, err := getPubKeyFiles(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	args := []string{
+		"-address", addr,
+		"-init",
+		"-key-shares", "3",
+		"-pgp-keys", pubFiles[0] + "," + pubFiles[1],
+		"-key-threshold", "2",
+	}
+	if code := c.Run(args); code == 0 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "-key-shares is 3 but 2 PGP keys") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+
+	config, err := core.RekeyConfig()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config != nil {
+		t.Fatal("rekey should not have been started")
+	}
+}
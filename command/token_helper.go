@@ -0,0 +1,126 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/command/token"
+)
+
+// TokenHelperCommand is a Command that configures the token helper used
+// by the CLI.
+type TokenHelperCommand struct {
+	Meta
+}
+
+// tokenHelperCheckValue is stored in the helper to verify that it works.
+const tokenHelperCheckValue = "vault-token-helper-check"
+
+func (c *TokenHelperCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("token-helper", FlagSetNone)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 2 || args[0] != "install" {
+		flags.Usage()
+		c.Ui.Error("\ntoken-helper expects the 'install' operation and an optional helper")
+		return 1
+	}
+
+	path := "disk"
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	// Verify the helper before pointing the CLI at it
+	helper := &token.Helper{Path: token.HelperPath(path)}
+	if err := verifyTokenHelper(helper); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Token helper %q is not working: %s", path, err))
+		return 1
+	}
+
+	configPath, err := ConfigPath("")
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	config := fmt.Sprintf("token_helper = %q\n", path)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error writing config %s: %s", configPath, err))
+		return 1
+	}
+
+	// Drop any loaded config so the new helper is used from now on
+	c.config = nil
+
+	c.Ui.Output(fmt.Sprintf(
+		"Success! Token helper %q installed in %s", path, configPath))
+	return 0
+}
+
+// verifyTokenHelper does a round-trip of a value through the helper. The
+// token stored in the helper, if any, is put back afterwards.
+func verifyTokenHelper(h *token.Helper) error {
+	existing, err := h.Get()
+	if err != nil {
+		return fmt.Errorf("get failed: %s", err)
+	}
+
+	if err := h.Store(tokenHelperCheckValue); err != nil {
+		return fmt.Errorf("store failed: %s", err)
+	}
+	v, err := h.Get()
+	if err != nil {
+		return fmt.Errorf("get failed: %s", err)
+	}
+	if v != tokenHelperCheckValue {
+		return fmt.Errorf("get returned %q instead of the stored value", v)
+	}
+	if err := h.Erase(); err != nil {
+		return fmt.Errorf("erase failed: %s", err)
+	}
+	v, err = h.Get()
+	if err != nil {
+		return fmt.Errorf("get failed: %s", err)
+	}
+	if v != "" {
+		return fmt.Errorf("get returned %q after erase", v)
+	}
+
+	if existing != "" {
+		if err := h.Store(existing); err != nil {
+			return fmt.Errorf("restoring the token failed: %s", err)
+		}
+	}
+	return nil
+}
+
+func (c *TokenHelperCommand) Synopsis() string {
+	return "Configure the token helper used by the CLI"
+}
+
+func (c *TokenHelperCommand) Help() string {
+	helpText := `
+Usage: vault token-helper install [helper]
+
+  Configures the CLI to store its token using the given token helper.
+
+  The helper is first verified by storing, reading and erasing a value
+  with it. If that works, the CLI configuration file (~/.vault, or the
+  path in VAULT_CONFIG_PATH) is written to use the helper. Any other
+  contents of the configuration file are replaced. A token already
+  stored in the helper is kept.
+
+  The helper is an absolute path to an executable, or the name of a
+  helper built into Vault. It defaults to "disk", which stores the token
+  unencrypted in ~/.vault-token.
+`
+	return strings.TrimSpace(helpText)
+}
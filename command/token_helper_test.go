@@ -0,0 +1,84 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/command/token"
+	"github.com/mitchellh/cli"
+)
+
+func TestTokenHelper_install(t *testing.T) {
+	td, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Set the HOME env var so the config and token land in the temp dir
+	os.Setenv("HOME", td)
+	os.Setenv(ConfigPathEnv, "")
+
+	path := token.TestProcessPath(t)
+	helper := &token.Helper{Path: path}
+	if err := helper.Store("foo"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &TokenHelperCommand{
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+	if code := c.Run([]string{"install", path}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(td, ".vault")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	m := &Meta{Ui: ui}
+	installed, err := m.TokenHelper()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if installed.Path != path {
+		t.Fatalf("bad: %s", installed.Path)
+	}
+	v, err := installed.Get()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v != "foo" {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
+func TestTokenHelper_installBroken(t *testing.T) {
+	td, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	os.Setenv("HOME", td)
+	os.Setenv(ConfigPathEnv, "")
+
+	ui := new(cli.MockUi)
+	c := &TokenHelperCommand{
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+	if code := c.Run([]string{"install", filepath.Join(td, "missing")}); code == 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	if _, err := os.Stat(filepath.Join(td, ".vault")); !os.IsNotExist(err) {
+		t.Fatalf("config should not have been written: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/packet"
@@ -20,16 +21,12 @@ func EncryptShares(secretShares [][]byte, pgpKeys []string) ([][]byte, error) {
 	if len(secretShares) != len(pgpKeys) {
 		return nil, fmt.Errorf("Mismatch between number of generated shares and number of PGP keys")
 	}
+	entities, err := GetEntities(pgpKeys)
+	if err != nil {
+		return nil, err
+	}
 	encryptedShares := [][]byte{}
-	for i, keystring := range pgpKeys {
-		data, err := base64.StdEncoding.DecodeString(keystring)
-		if err != nil {
-			return nil, fmt.Errorf("Error decoding given PGP key: %s", err)
-		}
-		entity, err := openpgp.ReadEntity(packet.NewReader(bytes.NewBuffer(data)))
-		if err != nil {
-			return nil, fmt.Errorf("Error parsing given PGP key: %s", err)
-		}
+	for i, entity := range entities {
 		ctBuf := bytes.NewBuffer(nil)
 		pt, err := openpgp.Encrypt(ctBuf, []*openpgp.Entity{entity}, nil, nil, nil)
 		if err != nil {
@@ -44,3 +41,27 @@ func EncryptShares(secretShares [][]byte, pgpKeys []string) ([][]byte, error) {
 	}
 	return encryptedShares, nil
 }
+
+// GetEntities parses the given base64-encoded PGP public keys, in order, and
+// ensures that each of them can be used to encrypt a message. The error
+// returned names the position of the first key that is unusable.
+func GetEntities(pgpKeys []string) ([]*openpgp.Entity, error) {
+	entities := make([]*openpgp.Entity, 0, len(pgpKeys))
+	for i, keystring := range pgpKeys {
+		data, err := base64.StdEncoding.DecodeString(keystring)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding given PGP key %d: %s", i+1, err)
+		}
+		entity, err := openpgp.ReadEntity(packet.NewReader(bytes.NewBuffer(data)))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing given PGP key %d: %s", i+1, err)
+		}
+		pt, err := openpgp.Encrypt(ioutil.Discard, []*openpgp.Entity{entity}, nil, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Given PGP key %d cannot be used for encryption: %s", i+1, err)
+		}
+		pt.Close()
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
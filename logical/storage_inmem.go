@@ -15,11 +15,25 @@ type InmemStorage struct {
 func (s *InmemStorage) List(prefix string) ([]string, error) {
 	s.once.Do(s.init)
 
+	// Like the physical backends, only the keys directly under the prefix
+	// are returned, relative to the prefix, and nested prefixes are
+	// returned once with a trailing slash.
 	var result []string
+	seen := make(map[string]struct{})
 	for k, _ := range s.Data {
-		if strings.HasPrefix(k, prefix) {
-			result = append(result, k)
+		if !strings.HasPrefix(k, prefix) {
+			continue
 		}
+
+		trimmed := strings.TrimPrefix(k, prefix)
+		if sep := strings.Index(trimmed, "/"); sep != -1 {
+			trimmed = trimmed[:sep+1]
+		}
+		if _, ok := seen[trimmed]; ok {
+			continue
+		}
+		seen[trimmed] = struct{}{}
+		result = append(result, trimmed)
 	}
 
 	return result, nil
@@ -1,9 +1,38 @@
 package logical
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 )
 
 func TestInmemStorage(t *testing.T) {
 	TestStorage(t, new(InmemStorage))
 }
+
+func TestInmemStorage_ListNested(t *testing.T) {
+	s := new(InmemStorage)
+	for _, k := range []string{"foo", "bar/baz", "bar/zip/zap"} {
+		if err := s.Put(&StorageEntry{Key: k}); err != nil {
+			t.Fatalf("put error: %s", err)
+		}
+	}
+
+	keys, err := s.List("")
+	if err != nil {
+		t.Fatalf("list error: %s", err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"bar/", "foo"}) {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+
+	keys, err = s.List("bar/")
+	if err != nil {
+		t.Fatalf("list error: %s", err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"baz", "zip/"}) {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+}
@@ -210,14 +210,20 @@ type ConsulLock struct {
 	lock   *api.Lock
 }
 
+// Lock acquires the lock by creating a Consul session and using it to
+// acquire the lock key. The returned channel is closed when the session is
+// invalidated or the key is otherwise lost, signaling loss of leadership.
 func (c *ConsulLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
 	return c.lock.Lock(stopCh)
 }
 
+// Unlock releases the lock key and destroys the associated session.
 func (c *ConsulLock) Unlock() error {
 	return c.lock.Unlock()
 }
 
+// Value returns whether the lock key is currently held by any session,
+// along with the value stored in it.
 func (c *ConsulLock) Value() (bool, string, error) {
 	kv := c.client.KV()
 	pair, _, err := kv.Get(c.key, nil)
@@ -3,13 +3,16 @@ package physical
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/hashicorp/vault/helper/uuid"
 )
 
 const (
@@ -33,6 +36,18 @@ const (
 
 	// The number of times to re-try a failed watch before signaling that leadership is lost.
 	EtcdWatchRetryMax = 5
+
+	// The size above which an encoded value is split into chunks, kept well
+	// below the limit of roughly 1.5MB that etcd enforces on a single value.
+	EtcdChunkSize = 1024 * 1024
+
+	// The suffix of the hidden directory holding the chunks of a value. The
+	// lock prefix is used for the directory, so it is excluded from listings.
+	EtcdNodeChunkSuffix = ".chunks"
+
+	// The value stored at the key of a chunked entry starts with this marker.
+	// It can't be mistaken for a base64 encoded value.
+	EtcdChunkMarker = "chunks:"
 )
 
 var (
@@ -80,6 +95,9 @@ func newEtcdBackend(conf map[string]string) (Backend, error) {
 	// Create a new client from the supplied addres and attempt to sync with the
 	// cluster.
 	client := etcd.NewClient(strings.Split(machines, EtcdMachineDelimiter))
+	if err := setEtcdConsistency(client, conf); err != nil {
+		return nil, err
+	}
 	if !client.SyncCluster() {
 		return nil, EtcdSyncClusterError
 	}
@@ -91,12 +109,47 @@ func newEtcdBackend(conf map[string]string) (Backend, error) {
 	}, nil
 }
 
+// setEtcdConsistency sets the consistency level of the reads made by the
+// client from the "consistency" configuration. Weak reads may be served by any
+// member and can be stale, while strong reads go through the leader at the
+// cost of latency. Reads are weakly consistent by default.
+func setEtcdConsistency(client *etcd.Client, conf map[string]string) error {
+	switch conf["consistency"] {
+	case "", "weak":
+		return client.SetConsistency(etcd.WEAK_CONSISTENCY)
+	case "strong":
+		return client.SetConsistency(etcd.STRONG_CONSISTENCY)
+	default:
+		return fmt.Errorf("invalid consistency %q: must be \"weak\" or \"strong\"", conf["consistency"])
+	}
+}
+
 // Put is used to insert or update an entry.
 func (c *EtcdBackend) Put(entry *Entry) error {
 	defer metrics.MeasureSince([]string{"etcd", "put"}, time.Now())
 	value := base64.StdEncoding.EncodeToString(entry.Value)
-	_, err := c.client.Set(c.nodePath(entry.Key), value, 0)
-	return err
+
+	// Values too large for etcd are written in chunks under a new generation
+	// first, and the key is then pointed at that generation, so that readers
+	// never see a partially written value.
+	if len(value) > EtcdChunkSize {
+		generation := uuid.GenerateUUID()
+		chunks := splitEtcdChunks(value, EtcdChunkSize)
+		for i, chunk := range chunks {
+			if _, err := c.client.Set(c.nodePathChunk(entry.Key, generation, i), chunk, 0); err != nil {
+				return err
+			}
+		}
+		value = formatEtcdChunkMarker(generation, len(chunks))
+	}
+
+	response, err := c.client.Set(c.nodePath(entry.Key), value, 0)
+	if err != nil {
+		return err
+	}
+
+	// Clean up the chunks of the value that was replaced.
+	return c.deleteChunks(entry.Key, response.PrevNode)
 }
 
 // Get is used to fetch an entry.
@@ -111,8 +164,22 @@ func (c *EtcdBackend) Get(key string) (*Entry, error) {
 		return nil, err
 	}
 
+	// Reassemble the value if it was stored in chunks.
+	encoded := response.Node.Value
+	if generation, count, ok := parseEtcdChunkMarker(encoded); ok {
+		chunks := make([]string, count)
+		for i := range chunks {
+			chunk, err := c.client.Get(c.nodePathChunk(key, generation, i), false, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read chunk %d of %q: %v", i, key, err)
+			}
+			chunks[i] = chunk.Node.Value
+		}
+		encoded = strings.Join(chunks, "")
+	}
+
 	// Decode the stored value from base-64.
-	value, err := base64.StdEncoding.DecodeString(response.Node.Value)
+	value, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, err
 	}
@@ -129,13 +196,74 @@ func (c *EtcdBackend) Delete(key string) error {
 	defer metrics.MeasureSince([]string{"etcd", "delete"}, time.Now())
 
 	// Remove the key, non-recursively.
-	_, err := c.client.Delete(c.nodePath(key), false)
+	response, err := c.client.Delete(c.nodePath(key), false)
+	if err != nil {
+		if errorIsMissingKey(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Remove the chunks of the deleted value, if any.
+	return c.deleteChunks(key, response.PrevNode)
+}
+
+// deleteChunks removes the chunks of the given previous node of a key, if its
+// value was stored in chunks.
+func (c *EtcdBackend) deleteChunks(key string, prevNode *etcd.Node) error {
+	if prevNode == nil {
+		return nil
+	}
+	generation, _, ok := parseEtcdChunkMarker(prevNode.Value)
+	if !ok {
+		return nil
+	}
+	_, err := c.client.Delete(c.nodePathChunkDir(key, generation), true)
 	if err != nil && !errorIsMissingKey(err) {
 		return err
 	}
+
+	// Remove the directory of the generations too, which only succeeds if
+	// the key isn't currently stored in chunks.
+	c.client.DeleteDir(c.nodePathChunks(key))
 	return nil
 }
 
+// splitEtcdChunks splits the given value into chunks of at most the given
+// size.
+func splitEtcdChunks(value string, size int) []string {
+	chunks := make([]string, 0, len(value)/size+1)
+	for len(value) > size {
+		chunks = append(chunks, value[:size])
+		value = value[size:]
+	}
+	return append(chunks, value)
+}
+
+// formatEtcdChunkMarker returns the value stored at the key of an entry whose
+// value is stored in the given number of chunks of the given generation.
+func formatEtcdChunkMarker(generation string, count int) string {
+	return fmt.Sprintf("%s%s:%d", EtcdChunkMarker, generation, count)
+}
+
+// parseEtcdChunkMarker returns the generation and the number of chunks of a
+// value stored in chunks. If the given value isn't a chunk marker, ok is
+// false.
+func parseEtcdChunkMarker(value string) (generation string, count int, ok bool) {
+	if !strings.HasPrefix(value, EtcdChunkMarker) {
+		return "", 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(value, EtcdChunkMarker), ":")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || count < 1 {
+		return "", 0, false
+	}
+	return parts[0], count, true
+}
+
 // List is used to list all the keys under a given prefix, up to the next
 // prefix.
 func (c *EtcdBackend) List(prefix string) ([]string, error) {
@@ -172,6 +300,56 @@ func (c *EtcdBackend) List(prefix string) ([]string, error) {
 	return out, nil
 }
 
+// ListRecursive is used to list all the keys under a given prefix, including
+// the keys within nested prefixes. Unlike List, the returned keys are full
+// slash-joined paths relative to the given prefix and no directories are
+// returned on their own. Lock directories are excluded.
+func (c *EtcdBackend) ListRecursive(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"etcd", "list-recursive"}, time.Now())
+
+	// Set a directory path from the given prefix.
+	path := c.nodePathDir(prefix)
+
+	// Get the directory, recursively, from etcd. If the directory is missing,
+	// we just return an empty list of contents.
+	response, err := c.client.Get(path, true, true)
+	if err != nil {
+		if errorIsMissingKey(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	return flattenEtcdNodes(path, response.Node.Nodes), nil
+}
+
+// flattenEtcdNodes walks the given nodes, which are the children of the etcd
+// directory at the given path, and returns the keys of all nested
+// non-directory nodes relative to that path.
+func flattenEtcdNodes(path string, nodes etcd.Nodes) []string {
+	out := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		// etcd keys include the full path, so let's trim the prefix directory
+		// path.
+		name := strings.TrimPrefix(node.Key, path)
+
+		if node.Dir {
+			// Semaphore keys of locks are not part of the stored data.
+			if strings.HasPrefix(name, EtcdNodeLockPrefix) {
+				continue
+			}
+			for _, child := range flattenEtcdNodes(node.Key+"/", node.Nodes) {
+				out = append(out, name+"/"+child)
+			}
+			continue
+		}
+
+		// Remove the node file prefix.
+		out = append(out, name[1:])
+	}
+	return out
+}
+
 // nodePath returns an etcd filepath based on the given key.
 func (b *EtcdBackend) nodePath(key string) string {
 	return filepath.Join(b.path, filepath.Dir(key), EtcdNodeFilePrefix+filepath.Base(key))
@@ -182,6 +360,24 @@ func (b *EtcdBackend) nodePathDir(key string) string {
 	return filepath.Join(b.path, key) + "/"
 }
 
+// nodePathChunks returns an etcd directory path holding the chunks of the
+// value of the given key.
+func (b *EtcdBackend) nodePathChunks(key string) string {
+	return filepath.Join(b.path, filepath.Dir(key), EtcdNodeLockPrefix+filepath.Base(key)+EtcdNodeChunkSuffix) + "/"
+}
+
+// nodePathChunkDir returns an etcd directory path holding the chunks of the
+// given generation of the value of the given key.
+func (b *EtcdBackend) nodePathChunkDir(key, generation string) string {
+	return filepath.Join(b.nodePathChunks(key), generation) + "/"
+}
+
+// nodePathChunk returns an etcd filepath of the chunk with the given index of
+// the given generation of the value of the given key.
+func (b *EtcdBackend) nodePathChunk(key, generation string, index int) string {
+	return filepath.Join(b.nodePathChunkDir(key, generation), fmt.Sprintf("%schunk-%d", EtcdNodeFilePrefix, index))
+}
+
 // nodePathLock returns an etcd directory path used specifically for semaphore
 // indicies based on the given key.
 func (b *EtcdBackend) nodePathLock(key string) string {
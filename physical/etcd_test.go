@@ -1,8 +1,11 @@
 package physical
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -37,6 +40,8 @@ func TestEtcdBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testEtcdBackend_ListRecursive(t, b.(*EtcdBackend))
+	testEtcdBackend_Chunking(t, b.(*EtcdBackend))
 
 	ha, ok := b.(HABackend)
 	if !ok {
@@ -44,3 +49,178 @@ func TestEtcdBackend(t *testing.T) {
 	}
 	testHABackend(t, ha, ha)
 }
+
+func TestEtcdBackend_consistency(t *testing.T) {
+	cases := map[string]string{
+		"":       etcd.WEAK_CONSISTENCY,
+		"weak":   etcd.WEAK_CONSISTENCY,
+		"strong": etcd.STRONG_CONSISTENCY,
+	}
+	for consistency, expected := range cases {
+		client := etcd.NewClient(nil)
+		client.SetConsistency(etcd.STRONG_CONSISTENCY)
+		if expected == etcd.STRONG_CONSISTENCY {
+			client.SetConsistency(etcd.WEAK_CONSISTENCY)
+		}
+
+		err := setEtcdConsistency(client, map[string]string{
+			"consistency": consistency,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		raw, err := client.MarshalJSON()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var out struct {
+			Config etcd.Config `json:"config"`
+		}
+		if err := json.Unmarshal(raw, &out); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if out.Config.Consistency != expected {
+			t.Fatalf("bad consistency for %q: %s", consistency, out.Config.Consistency)
+		}
+	}
+
+	err := setEtcdConsistency(etcd.NewClient(nil), map[string]string{
+		"consistency": "linearizable",
+	})
+	if err == nil {
+		t.Fatalf("expected error for invalid consistency")
+	}
+}
+
+func TestEtcdBackend_chunks(t *testing.T) {
+	chunks := splitEtcdChunks("abcdefgh", 3)
+	if !reflect.DeepEqual(chunks, []string{"abc", "def", "gh"}) {
+		t.Fatalf("bad: %v", chunks)
+	}
+	chunks = splitEtcdChunks("abcdef", 3)
+	if !reflect.DeepEqual(chunks, []string{"abc", "def"}) {
+		t.Fatalf("bad: %v", chunks)
+	}
+
+	marker := formatEtcdChunkMarker("foo", 3)
+	generation, count, ok := parseEtcdChunkMarker(marker)
+	if !ok || generation != "foo" || count != 3 {
+		t.Fatalf("bad: %s %d %v", generation, count, ok)
+	}
+
+	for _, value := range []string{"", "Zm9v", "chunks:foo", "chunks:foo:bar", "chunks:foo:0"} {
+		if _, _, ok := parseEtcdChunkMarker(value); ok {
+			t.Fatalf("should not be a chunk marker: %q", value)
+		}
+	}
+}
+
+func TestEtcdBackend_flattenNodes(t *testing.T) {
+	nodes := etcd.Nodes{
+		&etcd.Node{Key: "/vault/.foo"},
+		&etcd.Node{Key: "/vault/_foo", Dir: true, Nodes: etcd.Nodes{
+			&etcd.Node{Key: "/vault/_foo/00000000000000000001"},
+		}},
+		&etcd.Node{Key: "/vault/bar", Dir: true, Nodes: etcd.Nodes{
+			&etcd.Node{Key: "/vault/bar/.baz"},
+			&etcd.Node{Key: "/vault/bar/zip", Dir: true, Nodes: etcd.Nodes{
+				&etcd.Node{Key: "/vault/bar/zip/.zap"},
+			}},
+		}},
+	}
+
+	out := flattenEtcdNodes("/vault/", nodes)
+	expected := []string{"foo", "bar/baz", "bar/zip/zap"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("bad: %v expected: %v", out, expected)
+	}
+}
+
+func testEtcdBackend_ListRecursive(t *testing.T, b *EtcdBackend) {
+	keys := []string{"foo", "foo/bar", "foo/bar/baz", "foo/zip/zap"}
+	for _, key := range keys {
+		if err := b.Put(&Entry{Key: key, Value: []byte("test")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	out, err := b.ListRecursive("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(out)
+	if !reflect.DeepEqual(out, keys) {
+		t.Fatalf("bad: %v expected: %v", out, keys)
+	}
+
+	out, err = b.ListRecursive("foo/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(out)
+	expected := []string{"bar", "bar/baz", "zip/zap"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("bad: %v expected: %v", out, expected)
+	}
+
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func testEtcdBackend_Chunking(t *testing.T, b *EtcdBackend) {
+	// The value is larger than etcd accepts for a single key.
+	large := make([]byte, 2*1024*1024)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	if err := b.Put(&Entry{Key: "foo/large", Value: large}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out, err := b.Get("foo/large")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || !reflect.DeepEqual(out.Value, large) {
+		t.Fatalf("large value did not round-trip")
+	}
+
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"large"}) {
+		t.Fatalf("chunks should not be listed: %v", keys)
+	}
+
+	// Replacing the value with a small one removes the chunks.
+	if err := b.Put(&Entry{Key: "foo/large", Value: []byte("small")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err = b.Get("foo/large")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "small" {
+		t.Fatalf("bad: %v", out)
+	}
+	chunkDir := b.nodePathChunks("foo/large")
+	if _, err := b.client.Get(chunkDir, false, false); !errorIsMissingKey(err) {
+		t.Fatalf("chunks should have been removed: %v", err)
+	}
+
+	// Deleting a chunked value removes the chunks.
+	if err := b.Put(&Entry{Key: "foo/large", Value: large}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Delete("foo/large"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := b.client.Get(chunkDir, false, false); !errorIsMissingKey(err) {
+		t.Fatalf("chunks should have been removed: %v", err)
+	}
+}